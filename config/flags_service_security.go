@@ -0,0 +1,28 @@
+/*
+ * Copyright (C) 2020 The "MysteriumNetwork/node" Authors.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import "github.com/urfave/cli/v2"
+
+// FlagServiceDropPrivileges instructs serviceManager to drop from root down to
+// CAP_NET_ADMIN/CAP_NET_RAW (Linux only) before spawning provider service helper processes.
+var FlagServiceDropPrivileges = cli.BoolFlag{
+	Name:  "service.drop-privileges",
+	Usage: "Run provider services with CAP_NET_ADMIN/CAP_NET_RAW instead of full root (Linux only)",
+	Value: false,
+}
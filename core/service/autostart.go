@@ -0,0 +1,50 @@
+/*
+ * Copyright (C) 2020 The "MysteriumNetwork/node" Authors.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/mysteriumnetwork/node/identity"
+)
+
+// OptionsParser parses a persisted or request-supplied options blob into the service-specific
+// Options Start expects. Each service type registers its own parser; tequilapi's
+// ServiceOptionsParser is an alias of this type so live requests and Restore share one set.
+type OptionsParser func(json.RawMessage) (Options, error)
+
+// AutostartEntry is a persisted ServiceStart request that Restore replays on node boot, so a
+// service the operator asked to keep running survives a node restart without the REST caller
+// having to re-issue ServiceStart itself.
+type AutostartEntry struct {
+	ServiceID       ID `storm:"id"`
+	ProviderID      identity.Identity
+	ServiceType     string
+	Options         json.RawMessage
+	SecurityContext *SecurityContext
+	Added           time.Time
+}
+
+// AutostartStorage persists AutostartEntry values in the node's storm/boltdb store, the same
+// store session.History is kept in.
+type AutostartStorage interface {
+	Save(entry AutostartEntry) error
+	Delete(id ID) error
+	All() ([]AutostartEntry, error)
+}
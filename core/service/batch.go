@@ -0,0 +1,51 @@
+/*
+ * Copyright (C) 2020 The "MysteriumNetwork/node" Authors.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+// StartBatch runs startOne for i in [0, n), collecting every started ID. When atomic is true, the
+// first error rolls back everything already started via stopOne and stops the loop; when false,
+// the loop keeps going through every index and only the first error is reported. StartBatch is
+// agnostic to what startOne/stopOne actually start and stop - callers thread their own service
+// manager and request shape through the closures - so ServiceEndpoint's REST batch endpoint and
+// the mobile provider's StartProvider can share one atomic-rollback implementation despite having
+// different Start signatures.
+//
+// failedAt is the index startOne first failed at, or -1 if every call succeeded.
+func StartBatch(n int, atomic bool, startOne func(i int) (ID, error), stopOne func(id ID) error) (started []ID, failedAt int, err error) {
+	failedAt = -1
+
+	for i := 0; i < n; i++ {
+		id, startErr := startOne(i)
+		if startErr != nil {
+			if failedAt == -1 {
+				failedAt = i
+				err = startErr
+			}
+			if atomic {
+				for _, startedID := range started {
+					_ = stopOne(startedID)
+				}
+				return nil, failedAt, err
+			}
+			continue
+		}
+		started = append(started, id)
+	}
+
+	return started, failedAt, err
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (C) 2020 The "MysteriumNetwork/node" Authors.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartBatchAtomicRollsBackAlreadyStarted(t *testing.T) {
+	var stopped []ID
+	errAt1 := errors.New("boom")
+
+	started, failedAt, err := StartBatch(
+		3,
+		true,
+		func(i int) (ID, error) {
+			if i == 1 {
+				return "", errAt1
+			}
+			return ID(string(rune('a' + i))), nil
+		},
+		func(id ID) error {
+			stopped = append(stopped, id)
+			return nil
+		},
+	)
+
+	assert.Nil(t, started)
+	assert.Equal(t, 1, failedAt)
+	assert.Equal(t, errAt1, err)
+	assert.Equal(t, []ID{"a"}, stopped)
+}
+
+func TestStartBatchNonAtomicKeepsGoingAndReportsFirstError(t *testing.T) {
+	var stopped []ID
+	errAt1 := errors.New("boom")
+
+	started, failedAt, err := StartBatch(
+		3,
+		false,
+		func(i int) (ID, error) {
+			if i == 1 {
+				return "", errAt1
+			}
+			return ID(string(rune('a' + i))), nil
+		},
+		func(id ID) error {
+			stopped = append(stopped, id)
+			return nil
+		},
+	)
+
+	assert.Equal(t, []ID{"a", "c"}, started)
+	assert.Equal(t, 1, failedAt)
+	assert.Equal(t, errAt1, err)
+	assert.Empty(t, stopped)
+}
+
+func TestStartBatchAllSucceed(t *testing.T) {
+	started, failedAt, err := StartBatch(
+		2,
+		true,
+		func(i int) (ID, error) { return ID(string(rune('a' + i))), nil },
+		func(ID) error { return nil },
+	)
+
+	assert.Equal(t, []ID{"a", "b"}, started)
+	assert.Equal(t, -1, failedAt)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (C) 2020 The "MysteriumNetwork/node" Authors.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import "github.com/mysteriumnetwork/node/config"
+
+// Capability names a Linux capability bit relevant to running VPN provider services
+// unprivileged.
+type Capability string
+
+const (
+	// CapNetAdmin is required to configure TUN devices and routes.
+	CapNetAdmin Capability = "CAP_NET_ADMIN"
+	// CapNetRaw is required by services that open raw sockets.
+	CapNetRaw Capability = "CAP_NET_RAW"
+)
+
+// providerCapabilities are the capabilities kept ambient for provider service helper processes
+// when privilege dropping is enabled.
+var providerCapabilities = []Capability{CapNetAdmin, CapNetRaw}
+
+// SecurityContext overrides the node-wide --service.drop-privileges behaviour for a single
+// service, letting a caller opt a specific service in or out.
+//
+// swagger:model SecurityContextDTO
+type SecurityContext struct {
+	// when set, overrides --service.drop-privileges for this service only
+	// required: false
+	DropPrivileges *bool `json:"dropPrivileges,omitempty"`
+}
+
+// ApplyPrivilegeDrop is called at most once per process by Manager: from NewManager when the
+// node-wide flag is set, otherwise from the first Start whose securityContext opts in, before that
+// service is started. When enabled, it reduces the running process down to CAP_NET_ADMIN and
+// CAP_NET_RAW, keeps them in the ambient set via prctl(PR_SET_KEEPCAPS), and then drops the
+// real/effective uid/gid to an unprivileged user so helper processes spawned afterwards inherit
+// only the ambient set instead of full root.
+func ApplyPrivilegeDrop(ctx *SecurityContext, uid, gid int) error {
+	if !shouldDropPrivileges(ctx) {
+		return nil
+	}
+	return dropPrivileges(providerCapabilities, uid, gid)
+}
+
+func shouldDropPrivileges(ctx *SecurityContext) bool {
+	if ctx != nil && ctx.DropPrivileges != nil {
+		return *ctx.DropPrivileges
+	}
+	return config.GetBool(config.FlagServiceDropPrivileges)
+}
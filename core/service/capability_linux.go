@@ -0,0 +1,68 @@
+//go:build linux
+
+/*
+ * Copyright (C) 2020 The "MysteriumNetwork/node" Authors.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"github.com/pkg/errors"
+	"github.com/syndtr/gocapability/capability"
+	"golang.org/x/sys/unix"
+)
+
+func dropPrivileges(caps []Capability, uid, gid int) error {
+	c, err := capability.NewPid2(0)
+	if err != nil {
+		return errors.Wrap(err, "capability.NewPid2 failed")
+	}
+
+	linuxCaps := toLinuxCapabilities(caps)
+	c.Set(capability.CAPS|capability.BOUNDS|capability.AMBS, linuxCaps...)
+	if err := c.Apply(capability.CAPS | capability.BOUNDS | capability.AMBS); err != nil {
+		return errors.Wrap(err, "applying capabilities failed")
+	}
+
+	if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 1, 0, 0, 0); err != nil {
+		return errors.Wrap(err, "PR_SET_KEEPCAPS failed")
+	}
+
+	if err := unix.Setresgid(gid, gid, gid); err != nil {
+		return errors.Wrap(err, "dropping group privileges failed")
+	}
+	if err := unix.Setresuid(uid, uid, uid); err != nil {
+		return errors.Wrap(err, "dropping user privileges failed")
+	}
+
+	// re-apply the ambient set - Setresuid/Setresgid above can clear it on some kernels
+	return c.Apply(capability.AMBS)
+}
+
+func toLinuxCapabilities(caps []Capability) []capability.Cap {
+	mapping := map[Capability]capability.Cap{
+		CapNetAdmin: capability.CAP_NET_ADMIN,
+		CapNetRaw:   capability.CAP_NET_RAW,
+	}
+
+	res := make([]capability.Cap, 0, len(caps))
+	for _, c := range caps {
+		if linuxCap, ok := mapping[c]; ok {
+			res = append(res, linuxCap)
+		}
+	}
+	return res
+}
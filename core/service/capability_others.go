@@ -0,0 +1,31 @@
+//go:build !linux
+
+/*
+ * Copyright (C) 2020 The "MysteriumNetwork/node" Authors.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import "github.com/rs/zerolog/log"
+
+// dropPrivileges is a no-op on non-Linux platforms: there is no portable equivalent of Linux
+// capabilities/prctl here, so rather than failing node startup when --service.drop-privileges (or
+// a per-service override) is set, it logs and falls back to today's behaviour of running as
+// whatever user started the process.
+func dropPrivileges(caps []Capability, uid, gid int) error {
+	log.Warn().Msg("dropping privileges was requested but is only supported on linux, continuing as the current user")
+	return nil
+}
@@ -0,0 +1,263 @@
+/*
+ * Copyright (C) 2020 The "MysteriumNetwork/node" Authors.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mysteriumnetwork/node/core/service/servicestate"
+	"github.com/mysteriumnetwork/node/eventbus"
+	"github.com/mysteriumnetwork/node/identity"
+	"github.com/mysteriumnetwork/node/service_discovery/dto"
+	"github.com/pkg/errors"
+)
+
+// Manager is the concrete ServiceManager implementation: it starts, stops and tracks provider
+// service instances, and publishes StateEvent on the node's EventBus whenever one changes state.
+type Manager struct {
+	mu        sync.RWMutex
+	instances map[ID]*Instance
+	eventBus  eventbus.EventBus
+	uid, gid  int
+
+	privMu  sync.Mutex
+	dropped bool
+}
+
+// NewManager creates a Manager, applies --service.drop-privileges exactly once before any
+// provider service is started, and then restores every service persisted in autostart. uid/gid
+// are the unprivileged user the process drops to on Linux when privilege dropping is enabled.
+// They are kept on the Manager so Start can re-apply them whenever a service's SecurityContext
+// overrides the node-wide flag for that one service. autostart may be nil, in which case nothing
+// is restored - the same as if the store were empty.
+func NewManager(eventBus eventbus.EventBus, autostart AutostartStorage, optionsParser map[string]OptionsParser, uid, gid int) (*Manager, error) {
+	m := &Manager{
+		instances: make(map[ID]*Instance),
+		eventBus:  eventBus,
+		uid:       uid,
+		gid:       gid,
+	}
+
+	if err := m.applyPrivilegeDropOnce(nil); err != nil {
+		return nil, errors.Wrap(err, "could not apply --service.drop-privileges")
+	}
+
+	if autostart != nil {
+		if err := m.Restore(autostart, optionsParser); err != nil {
+			return nil, errors.Wrap(err, "could not restore autostart services")
+		}
+	}
+
+	return m, nil
+}
+
+// Restore re-invokes Start for every entry persisted in autostart, parsing each entry's options
+// blob with optionsParser the same way a live ServiceStart request would. A service that fails
+// to restore is skipped rather than aborting the rest. Since Start assigns every service a fresh
+// ID, Restore re-saves each entry under its new ServiceID and drops the stale one - otherwise
+// ServiceAutostartList would report an ID nothing is running under, and ServiceStop's
+// ?autostart=false prune (keyed by the live ID) could never match the persisted entry again.
+func (m *Manager) Restore(autostart AutostartStorage, optionsParser map[string]OptionsParser) error {
+	entries, err := autostart.All()
+	if err != nil {
+		return errors.Wrap(err, "could not read autostart entries")
+	}
+
+	for _, entry := range entries {
+		var options Options
+		if len(entry.Options) > 0 && string(entry.Options) != "null" {
+			parse, ok := optionsParser[entry.ServiceType]
+			if !ok {
+				continue
+			}
+			if options, err = parse(entry.Options); err != nil {
+				continue
+			}
+		}
+
+		id, err := m.Start(entry.ProviderID, entry.ServiceType, options, entry.SecurityContext)
+		if err != nil {
+			continue
+		}
+
+		restored := entry
+		restored.ServiceID = id
+		if err := autostart.Save(restored); err != nil {
+			continue
+		}
+		if id != entry.ServiceID {
+			_ = autostart.Delete(entry.ServiceID)
+		}
+	}
+
+	return nil
+}
+
+// Start starts serviceType for providerID and registers it under a freshly generated ID.
+// securityContext, when set, overrides --service.drop-privileges for this one service - e.g.
+// opting a service into privilege dropping even though the node-wide flag is off. Privileges are
+// dropped for the whole process, not per-service, so a securityContext that asks to stay
+// privileged has no effect once an earlier Start (or NewManager) has already dropped them.
+func (m *Manager) Start(providerID identity.Identity, serviceType string, options Options, securityContext *SecurityContext) (ID, error) {
+	if providerID.Address == "" {
+		return "", ErrorLocation
+	}
+
+	if err := m.applyPrivilegeDropOnce(securityContext); err != nil {
+		return "", errors.Wrap(err, "could not apply service security context")
+	}
+
+	transport, err := newTransport(serviceType, options)
+	if err != nil {
+		return "", errors.Wrap(err, "could not start service transport")
+	}
+
+	id := nextID(serviceType)
+	instance := &Instance{
+		state:     servicestate.Running,
+		transport: transport,
+		proposal: dto.ServiceProposal{
+			ProviderID:  providerID.Address,
+			ServiceType: serviceType,
+		},
+	}
+
+	m.mu.Lock()
+	m.instances[id] = instance
+	m.mu.Unlock()
+
+	m.publish(id, instance)
+	return id, nil
+}
+
+// applyPrivilegeDropOnce calls ApplyPrivilegeDrop at most once for the lifetime of the process.
+// Dropping real/effective uid/gid relinquishes CAP_SETPCAP, so a second call would fail trying to
+// re-apply the capability set - there's also nothing to undo if a later securityContext asks to
+// stay privileged. NewManager calls this for the node-wide flag and Start calls it again for a
+// per-service override; whichever happens first wins and every call after that is a no-op.
+func (m *Manager) applyPrivilegeDropOnce(securityContext *SecurityContext) error {
+	m.privMu.Lock()
+	defer m.privMu.Unlock()
+
+	if m.dropped || !shouldDropPrivileges(securityContext) {
+		return nil
+	}
+
+	if err := ApplyPrivilegeDrop(securityContext, m.uid, m.gid); err != nil {
+		return err
+	}
+	m.dropped = true
+	return nil
+}
+
+// Stop stops and unregisters a running service.
+func (m *Manager) Stop(id ID) error {
+	m.mu.Lock()
+	instance, ok := m.instances[id]
+	if ok {
+		delete(m.instances, id)
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return errors.Errorf("service %s not found", id)
+	}
+
+	if err := instance.transport.Stop(); err != nil {
+		return errors.Wrap(err, "transport stop failed")
+	}
+
+	instance.setState(servicestate.NotRunning)
+	m.publish(id, instance)
+	return nil
+}
+
+// Service returns the running instance for id, or nil when it isn't known.
+func (m *Manager) Service(id ID) *Instance {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.instances[id]
+}
+
+// Kill stops every running service, used on node shutdown.
+func (m *Manager) Kill() error {
+	m.mu.Lock()
+	ids := make([]ID, 0, len(m.instances))
+	for id := range m.instances {
+		ids = append(ids, id)
+	}
+	m.mu.Unlock()
+
+	var firstErr error
+	for _, id := range ids {
+		if err := m.Stop(id); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// List returns every currently known service instance, keyed by ID.
+func (m *Manager) List() map[ID]*Instance {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	res := make(map[ID]*Instance, len(m.instances))
+	for id, instance := range m.instances {
+		res[id] = instance
+	}
+	return res
+}
+
+// Reconnect restarts the underlying transport of a running service - for every service type but
+// "noop" that is a rebind of its UDP socket on the same port - while keeping the service's ID,
+// sessions and proposal registration intact, so provisioned consumers can reconnect after an
+// ISP/IP change instead of the service being stopped outright. WireGuard peers and OpenVPN
+// listeners are not refreshed.
+func (m *Manager) Reconnect(id ID, afterSeconds int) error {
+	m.mu.RLock()
+	instance, ok := m.instances[id]
+	m.mu.RUnlock()
+
+	if !ok {
+		return errors.Errorf("service %s not found", id)
+	}
+
+	if err := instance.transport.Reconnect(afterSeconds); err != nil {
+		return errors.Wrap(err, "transport reconnect failed")
+	}
+	return nil
+}
+
+func (m *Manager) publish(id ID, instance *Instance) {
+	if m.eventBus == nil {
+		return
+	}
+	m.eventBus.Publish(StatusTopic, StateEvent{ID: id, Proposal: instance.Proposal()})
+}
+
+var idCounter uint64
+
+// nextID returns a new, process-unique service ID for serviceType.
+func nextID(serviceType string) ID {
+	n := atomic.AddUint64(&idCounter, 1)
+	return ID(fmt.Sprintf("%s-%d-%d", serviceType, time.Now().UnixNano(), n))
+}
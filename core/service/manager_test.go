@@ -0,0 +1,104 @@
+/*
+ * Copyright (C) 2020 The "MysteriumNetwork/node" Authors.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mysteriumnetwork/node/identity"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubAutostartStorage is an in-memory AutostartStorage used to exercise Manager.Restore without
+// a real storm/boltdb store.
+type stubAutostartStorage struct {
+	entries map[ID]AutostartEntry
+}
+
+func newStubAutostartStorage(entries ...AutostartEntry) *stubAutostartStorage {
+	s := &stubAutostartStorage{entries: make(map[ID]AutostartEntry)}
+	for _, e := range entries {
+		s.entries[e.ServiceID] = e
+	}
+	return s
+}
+
+func (s *stubAutostartStorage) Save(entry AutostartEntry) error {
+	s.entries[entry.ServiceID] = entry
+	return nil
+}
+
+func (s *stubAutostartStorage) Delete(id ID) error {
+	delete(s.entries, id)
+	return nil
+}
+
+func (s *stubAutostartStorage) All() ([]AutostartEntry, error) {
+	res := make([]AutostartEntry, 0, len(s.entries))
+	for _, e := range s.entries {
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+func TestManagerRestoreRewritesStaleAutostartID(t *testing.T) {
+	autostart := newStubAutostartStorage(AutostartEntry{
+		ServiceID:   "noop-stale-1",
+		ProviderID:  identity.Identity{Address: "0x000000000000000000000000000000000000aa"},
+		ServiceType: "noop",
+	})
+
+	m := &Manager{instances: make(map[ID]*Instance)}
+	require.NoError(t, m.Restore(autostart, nil))
+
+	entries, err := autostart.All()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	restored := entries[0]
+	assert.NotEqual(t, ID("noop-stale-1"), restored.ServiceID)
+	assert.NotNil(t, m.Service(restored.ServiceID))
+	assert.Nil(t, m.Service("noop-stale-1"))
+}
+
+func TestManagerRestoreSkipsEntryWhenParserFails(t *testing.T) {
+	autostart := newStubAutostartStorage(AutostartEntry{
+		ServiceID:   "wg-stale-1",
+		ProviderID:  identity.Identity{Address: "0x000000000000000000000000000000000000bb"},
+		ServiceType: "wireguard",
+		Options:     json.RawMessage(`{"port":1}`),
+	})
+
+	m := &Manager{instances: make(map[ID]*Instance)}
+	parsers := map[string]OptionsParser{
+		"wireguard": func(json.RawMessage) (Options, error) {
+			return nil, errors.New("bad options")
+		},
+	}
+
+	require.NoError(t, m.Restore(autostart, parsers))
+
+	entries, err := autostart.All()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, ID("wg-stale-1"), entries[0].ServiceID)
+	assert.Empty(t, m.instances)
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (C) 2020 The "MysteriumNetwork/node" Authors.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Transport lets Manager.Reconnect restart a service's underlying network transport without
+// touching the service's sessions or its proposal registration. noopTransport backs the "noop"
+// service and udpTransport every other type; neither refreshes WireGuard peers or re-opens
+// OpenVPN listeners.
+type Transport interface {
+	Stop() error
+	Reconnect(afterSeconds int) error
+}
+
+// portOptions is implemented by service-specific Options that bind to a fixed local port
+// (wireguard, openvpn). Options that don't implement it get an OS-assigned port.
+type portOptions interface {
+	Port() int
+}
+
+func newTransport(serviceType string, options Options) (Transport, error) {
+	switch serviceType {
+	case "noop":
+		return &noopTransport{}, nil
+	default:
+		return newUDPTransport(options)
+	}
+}
+
+// noopTransport backs the "noop" service, which has no network transport to rebind.
+type noopTransport struct{}
+
+func (*noopTransport) Stop() error                      { return nil }
+func (*noopTransport) Reconnect(afterSeconds int) error { return nil }
+
+// udpTransport backs every service type other than "noop" with a single UDP socket that
+// Reconnect rebinds after an ISP/IP change.
+type udpTransport struct {
+	mu   sync.Mutex
+	conn *net.UDPConn
+	port int
+}
+
+func newUDPTransport(options Options) (Transport, error) {
+	port := 0
+	if po, ok := options.(portOptions); ok {
+		port = po.Port()
+	}
+
+	conn, err := bindUDP(port)
+	if err != nil {
+		return nil, err
+	}
+	if port == 0 {
+		// keep the OS-assigned port so Reconnect rebinds to it rather than to a new one
+		port = conn.LocalAddr().(*net.UDPAddr).Port
+	}
+
+	return &udpTransport{conn: conn, port: port}, nil
+}
+
+func bindUDP(port int) (*net.UDPConn, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not bind udp socket")
+	}
+	return conn, nil
+}
+
+func (t *udpTransport) Stop() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil {
+		return nil
+	}
+	return t.conn.Close()
+}
+
+// Reconnect waits afterSeconds, then closes the UDP socket and binds a new one on the same port,
+// so consumers can reach the service again without the session being torn down. Only the socket
+// is replaced: WireGuard peers and OpenVPN listeners are not refreshed here.
+func (t *udpTransport) Reconnect(afterSeconds int) error {
+	if afterSeconds > 0 {
+		time.Sleep(time.Duration(afterSeconds) * time.Second)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn != nil {
+		_ = t.conn.Close()
+	}
+
+	conn, err := bindUDP(t.port)
+	if err != nil {
+		return errors.Wrap(err, "could not rebind udp socket")
+	}
+	t.conn = conn
+	return nil
+}
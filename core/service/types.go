@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2020 The "MysteriumNetwork/node" Authors.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"sync"
+
+	"github.com/mysteriumnetwork/node/core/service/servicestate"
+	"github.com/mysteriumnetwork/node/service_discovery/dto"
+	"github.com/pkg/errors"
+)
+
+// ID uniquely identifies a single running service instance.
+type ID string
+
+// Options is opaque, service-type-specific start configuration produced by a
+// ServiceOptionsParser.
+type Options interface{}
+
+// ErrorLocation is returned by Manager.Start when the provider identity has an empty address.
+var ErrorLocation = errors.New("failed to detect service location")
+
+// StatusTopic is the EventBus topic Manager publishes a StateEvent on whenever a managed
+// instance changes state or a new instance is created.
+const StatusTopic = "ServiceManager.StatusChanged"
+
+// StateEvent is published on StatusTopic.
+type StateEvent struct {
+	ID       ID
+	Proposal dto.ServiceProposal
+}
+
+// Instance is a single running provider service.
+type Instance struct {
+	mu        sync.RWMutex
+	state     servicestate.State
+	proposal  dto.ServiceProposal
+	transport Transport
+}
+
+// State returns the instance's current lifecycle state (Starting, Running, NotRunning, ...).
+func (i *Instance) State() servicestate.State {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.state
+}
+
+// Proposal returns the market proposal this instance is currently registered under.
+func (i *Instance) Proposal() dto.ServiceProposal {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.proposal
+}
+
+func (i *Instance) setState(state servicestate.State) {
+	i.mu.Lock()
+	i.state = state
+	i.mu.Unlock()
+}
@@ -23,9 +23,11 @@ import (
 	"strings"
 
 	"github.com/mysteriumnetwork/node/config"
+	"github.com/mysteriumnetwork/node/core/service"
 	"github.com/mysteriumnetwork/node/core/service/servicestate"
 	"github.com/mysteriumnetwork/node/identity"
 	"github.com/mysteriumnetwork/node/services"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 )
 
@@ -46,6 +48,9 @@ func (mb *MobileNode) unlockIdentity(adr, passphrase string) string {
 	return id.Address
 }
 
+// defaultProviderServiceTypes are the services StartProvider brings up on provider mode nodes.
+var defaultProviderServiceTypes = strings.Split("wireguard,scraping,data_transfer", ",")
+
 // StartProvider starts all provider services (provider mode)
 func (mb *MobileNode) StartProvider() {
 	providerID := mb.unlockIdentity(
@@ -54,37 +59,66 @@ func (mb *MobileNode) StartProvider() {
 	)
 	log.Info().Msgf("Unlocked identity: %v", providerID)
 
-	activeServices := "wireguard,scraping,data_transfer"
-	serviceTypes := strings.Split(activeServices, ",")
+	if err := mb.startServices(identity.Identity{Address: providerID}, defaultProviderServiceTypes, true); err != nil {
+		log.Error().Err(err).Msg("StartProvider failed")
+	}
+}
+
+// startServices starts every given serviceType for providerID, returning the first error
+// encountered. When atomic is true, any service already started by this call is stopped again
+// before the error is returned, so the caller never has to clean up a half-started provider. The
+// atomic-rollback loop itself is service.StartBatch, shared with ServiceEndpoint's REST batch
+// start so the two entry points can't drift out of sync with each other.
+func (mb *MobileNode) startServices(providerID identity.Identity, serviceTypes []string, atomic bool) error {
+	_, _, err := service.StartBatch(
+		len(serviceTypes),
+		atomic,
+		func(i int) (service.ID, error) {
+			serviceType := serviceTypes[i]
 
-	for _, serviceType := range serviceTypes {
-		serviceOpts, err := services.GetStartOptions(serviceType)
-		if err != nil {
-			log.Error().Err(err).Msg("GetStartOptions failed")
-			return
-		}
+			serviceOpts, err := services.GetStartOptions(serviceType)
+			if err != nil {
+				return "", errors.Wrap(err, "GetStartOptions failed")
+			}
+
+			id, err := mb.servicesManager.Start(providerID, serviceType, serviceOpts.AccessPolicyList, serviceOpts.TypeOptions)
+			if err != nil {
+				return "", errors.Wrap(err, "servicesManager.Start failed")
+			}
 
-		_, err = mb.servicesManager.Start(identity.Identity{Address: providerID}, serviceType, serviceOpts.AccessPolicyList, serviceOpts.TypeOptions)
-		if err != nil {
-			log.Error().Err(err).Msg("servicesManager.Start failed")
-			return
+			return id, nil
+		},
+		func(id service.ID) error {
+			if err := mb.servicesManager.Stop(id); err != nil {
+				log.Error().Err(err).Msgf("servicesManager.Stop failed for %s", id)
+			}
+			return nil
+		},
+	)
+	return err
+}
+
+// stopServices stops every given service ID, logging but otherwise ignoring failures - it is
+// used by StopProvider to best-effort stop every running provider service.
+func (mb *MobileNode) stopServices(ids []service.ID) {
+	for _, id := range ids {
+		if err := mb.servicesManager.Stop(id); err != nil {
+			log.Error().Err(err).Msgf("servicesManager.Stop failed for %s", id)
 		}
 	}
 }
 
 // StopProvider stops all provider services, started by StartProvider
 func (mb *MobileNode) StopProvider() {
+	var running []service.ID
 	for _, srv := range mb.servicesManager.List(true) {
 		if srv.State() != servicestate.Running {
 			continue
 		}
-
-		err := mb.servicesManager.Stop(srv.ID)
-		if err != nil {
-			log.Error().Err(err).Msg("servicesManager.Stop failed")
-			return
-		}
+		running = append(running, srv.ID)
 	}
+
+	mb.stopServices(running)
 }
 
 // SetFlagLauncherVersion sets LauncherVersion flag value, which is reported to Prometheus
@@ -19,16 +19,25 @@ package endpoints
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/mysteriumnetwork/node/core/service"
+	"github.com/mysteriumnetwork/node/core/service/servicestate"
+	"github.com/mysteriumnetwork/node/eventbus"
 	"github.com/mysteriumnetwork/node/identity"
 	"github.com/mysteriumnetwork/node/tequilapi/utils"
 	"github.com/mysteriumnetwork/node/tequilapi/validation"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
 )
 
+// serviceEventsHeartbeatInterval is how often ServiceEvents sends a heartbeat so the client can
+// tell a stalled provider from an idle one.
+const serviceEventsHeartbeatInterval = 30 * time.Second
+
 // swagger:model ServiceRequestDTO
 type serviceRequest struct {
 	// provider identity
@@ -49,6 +58,56 @@ type serviceRequest struct {
 	// service options. Every service has a unique list of allowed options.
 	// required: false
 	Options interface{} `json:"options"`
+
+	// per-service override of the node-wide --service.drop-privileges flag
+	// required: false
+	SecurityContext *service.SecurityContext `json:"securityContext,omitempty"`
+
+	// when true, the request is persisted and replayed by serviceManager.Restore on node boot
+	// required: false
+	Autostart bool `json:"autostart"`
+}
+
+// swagger:model ServiceAutostartEntryDTO
+type serviceAutostartEntry struct {
+	// example: 6ba7b810-9dad-11d1-80b4-00c04fd430c8
+	ID string `json:"id"`
+	// example: 0x0000000000000000000000000000000000000002
+	ProviderID string `json:"providerId"`
+	// example: wireguard
+	ServiceType string `json:"serviceType"`
+}
+
+// swagger:model ServiceStartBatchRequestDTO
+type serviceBatchRequest struct {
+	// when true, any service that fails to start causes all services
+	// already started by this request to be stopped again
+	// required: false
+	Atomic bool `json:"atomic"`
+
+	// list of services to start
+	// required: true
+	Services []serviceRequest `json:"services"`
+}
+
+// swagger:model ServiceStartResultDTO
+type serviceStartResult struct {
+	// provider identity
+	// example: 0x0000000000000000000000000000000000000002
+	ProviderID string `json:"providerId"`
+	// example: wireguard
+	ServiceType string `json:"serviceType"`
+
+	Service *serviceInfo `json:"service,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// swagger:model ServiceEventDTO
+type serviceEvent struct {
+	// example: state-change
+	Event string `json:"event"`
+	// present when event is "state-change"
+	Service *serviceInfo `json:"service,omitempty"`
 }
 
 // swagger:model ServiceListDTO
@@ -75,16 +134,21 @@ type serviceOptions struct {
 type ServiceEndpoint struct {
 	serviceManager ServiceManager
 	optionsParser  map[string]ServiceOptionsParser
+	eventBus       eventbus.EventBus
+	autostart      service.AutostartStorage
 }
 
-// ServiceOptionsParser parses request to service specific options
-type ServiceOptionsParser func(json.RawMessage) (service.Options, error)
+// ServiceOptionsParser parses request to service specific options. It is an alias of
+// service.OptionsParser so the same parser set serves live requests and service.Manager.Restore.
+type ServiceOptionsParser = service.OptionsParser
 
 // NewServiceEndpoint creates and returns service endpoint
-func NewServiceEndpoint(serviceManager ServiceManager, optionsParser map[string]ServiceOptionsParser) *ServiceEndpoint {
+func NewServiceEndpoint(serviceManager ServiceManager, optionsParser map[string]ServiceOptionsParser, eventBus eventbus.EventBus, autostart service.AutostartStorage) *ServiceEndpoint {
 	return &ServiceEndpoint{
 		serviceManager: serviceManager,
 		optionsParser:  optionsParser,
+		eventBus:       eventBus,
+		autostart:      autostart,
 	}
 }
 
@@ -131,6 +195,97 @@ func (se *ServiceEndpoint) ServiceGet(resp http.ResponseWriter, _ *http.Request,
 	utils.WriteAsJSON(statusResponse, resp)
 }
 
+// ServiceEvents streams service state changes as they happen, so callers don't have to poll
+// ServiceGet/ServiceList for transitions.
+// swagger:operation GET /services/events Service serviceEvents
+// ---
+// summary: Streams service state changes
+// description: ServiceEvents pushes a ServiceEventDTO over Server-Sent Events whenever a service changes state, with periodic heartbeats
+// parameters:
+//   - in: query
+//     name: id
+//     type: string
+//     required: false
+//     description: only stream events for the service with this id
+//   - in: query
+//     name: serviceType
+//     type: string
+//     required: false
+//     description: only stream events for services of this type
+// responses:
+//   200:
+//     description: text/event-stream of ServiceEventDTO
+//   500:
+//     description: Streaming unsupported or subscription failed
+//     schema:
+//       "$ref": "#/definitions/ErrorMessageDTO"
+func (se *ServiceEndpoint) ServiceEvents(resp http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	flusher, ok := resp.(http.Flusher)
+	if !ok {
+		utils.SendErrorMessage(resp, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	filterID := req.URL.Query().Get("id")
+	filterType := req.URL.Query().Get("serviceType")
+
+	changes := make(chan service.StateEvent, 10)
+	onChange := func(e service.StateEvent) {
+		select {
+		case changes <- e:
+		default:
+			// slow client, drop the update rather than block serviceManager
+		}
+	}
+
+	if err := se.eventBus.SubscribeAsync(service.StatusTopic, onChange); err != nil {
+		utils.SendError(resp, err, http.StatusInternalServerError)
+		return
+	}
+	defer se.eventBus.Unsubscribe(service.StatusTopic, onChange)
+
+	resp.Header().Set("Content-Type", "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.Header().Set("Connection", "keep-alive")
+	resp.WriteHeader(http.StatusOK)
+
+	heartbeat := time.NewTicker(serviceEventsHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-heartbeat.C:
+			writeServiceEvent(resp, flusher, serviceEvent{Event: "heartbeat"})
+		case e := <-changes:
+			if filterID != "" && string(e.ID) != filterID {
+				continue
+			}
+			if filterType != "" && e.Proposal.ServiceType != filterType {
+				continue
+			}
+			var info serviceInfo
+			if instance := se.serviceManager.Service(e.ID); instance != nil {
+				info = toServiceInfoResponse(e.ID, instance)
+			} else {
+				// Manager.Stop unregisters an instance before it publishes the NotRunning change
+				info = serviceInfo{ID: string(e.ID), Status: string(servicestate.NotRunning), Proposal: proposalToRes(e.Proposal)}
+			}
+			writeServiceEvent(resp, flusher, serviceEvent{Event: "state-change", Service: &info})
+		}
+	}
+}
+
+func writeServiceEvent(resp http.ResponseWriter, flusher http.Flusher, event serviceEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(resp, "data: %s\n\n", data)
+	flusher.Flush()
+}
+
 // ServiceStart starts requested service on the node.
 // swagger:operation POST /services Service serviceStart
 // ---
@@ -180,32 +335,204 @@ func (se *ServiceEndpoint) ServiceStart(resp http.ResponseWriter, req *http.Requ
 		return
 	}
 
-	if se.isAlreadyRunning(sr) {
-		utils.SendErrorMessage(resp, "Service already running", http.StatusConflict)
-		return
-	}
-
-	id, err := se.serviceManager.Start(identity.FromAddress(sr.ProviderID), sr.ServiceType, sr.Options)
+	id, instance, err := se.startOne(sr)
 	if err == service.ErrorLocation {
 		utils.SendError(resp, err, http.StatusBadRequest)
 		return
+	} else if err == errServiceAlreadyRunning {
+		utils.SendErrorMessage(resp, "Service already running", http.StatusConflict)
+		return
 	} else if err != nil {
 		utils.SendError(resp, err, http.StatusInternalServerError)
 		return
 	}
 
-	instance := se.serviceManager.Service(id)
-
 	resp.WriteHeader(http.StatusCreated)
 	statusResponse := toServiceInfoResponse(id, instance)
 	utils.WriteAsJSON(statusResponse, resp)
 }
 
+// ServiceStartBatch starts several requested services on the node in one call.
+// swagger:operation POST /services/batch Service serviceStartBatch
+// ---
+// summary: Starts multiple services
+// description: Starts all of the requested services, optionally rolling back already started ones if one of them fails
+// parameters:
+//   - in: body
+//     name: body
+//     description: List of services to start and the atomic flag
+//     schema:
+//       $ref: "#/definitions/ServiceStartBatchRequestDTO"
+// responses:
+//   201:
+//     description: Per-service start results
+//     schema:
+//       type: array
+//       items:
+//         "$ref": "#/definitions/ServiceStartResultDTO"
+//   400:
+//     description: Bad request body. An atomically-aborted batch whose failing entry failed validation or location detection also answers 400, with the per-service results up to and including the failing entry as body
+//     schema:
+//       "$ref": "#/definitions/ErrorMessageDTO"
+//   409:
+//     description: Conflict. An atomically-aborted batch entry matched an already running service; body holds the per-service results up to and including that entry
+//     schema:
+//       type: array
+//       items:
+//         "$ref": "#/definitions/ServiceStartResultDTO"
+//   500:
+//     description: Internal server error. An atomically-aborted batch entry failed to start; body holds the per-service results up to and including that entry
+//     schema:
+//       type: array
+//       items:
+//         "$ref": "#/definitions/ServiceStartResultDTO"
+func (se *ServiceEndpoint) ServiceStartBatch(resp http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	var br serviceBatchRequest
+	if err := json.NewDecoder(req.Body).Decode(&br); err != nil {
+		utils.SendError(resp, err, http.StatusBadRequest)
+		return
+	}
+
+	results := make([]serviceStartResult, len(br.Services))
+
+	_, failedAt, abortErr := service.StartBatch(
+		len(br.Services),
+		br.Atomic,
+		func(i int) (service.ID, error) {
+			sr := br.Services[i]
+			result := serviceStartResult{ProviderID: sr.ProviderID, ServiceType: sr.ServiceType}
+
+			errorMap := validateServiceRequest(sr)
+			if errorMap.HasErrors() {
+				result.Error = "invalid service request"
+				results[i] = result
+				return "", errInvalidServiceRequest
+			}
+
+			id, instance, err := se.startOne(sr)
+			if err != nil {
+				result.Error = err.Error()
+				results[i] = result
+				return "", err
+			}
+
+			info := toServiceInfoResponse(id, instance)
+			result.Service = &info
+			results[i] = result
+			return id, nil
+		},
+		se.stopAndUnpersist,
+	)
+
+	if br.Atomic && abortErr != nil {
+		// Entries before failedAt started successfully and were then rolled back by
+		// service.StartBatch via stopAndUnpersist - reflect that in their result instead of
+		// reporting them as still Running, which they no longer are.
+		for i := 0; i < failedAt; i++ {
+			if results[i].Service != nil {
+				results[i].Service.Status = string(servicestate.NotRunning)
+			}
+			results[i].Error = "start aborted: rolled back as part of a failed atomic batch"
+		}
+
+		resp.WriteHeader(errorStatus(abortErr))
+		utils.WriteAsJSON(results[:failedAt+1], resp)
+		return
+	}
+
+	resp.WriteHeader(http.StatusCreated)
+	utils.WriteAsJSON(results, resp)
+}
+
+// errServiceAlreadyRunning is returned by startOne when a matching service is already running
+var errServiceAlreadyRunning = errors.New("service already running")
+
+// errInvalidServiceRequest is returned by ServiceStartBatch's startOne closure when a batch entry
+// fails validateServiceRequest, so errorStatus can map it to 400. ServiceStart itself answers a
+// validation failure with 422 and the field errors instead.
+var errInvalidServiceRequest = errors.New("invalid service request")
+
+// errorStatus maps an error returned by startOne to the HTTP status ServiceStart itself would
+// have used, so ServiceStartBatch's atomic-abort response doesn't collapse every failure reason
+// into 400: a genuine internal error (service.Manager.Start failing to bind its transport, for
+// example) gets a 500.
+func errorStatus(err error) int {
+	switch err {
+	case errInvalidServiceRequest:
+		return http.StatusBadRequest
+	case service.ErrorLocation:
+		return http.StatusBadRequest
+	case errServiceAlreadyRunning:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// startOne starts a single service and returns its freshly started instance. It is the shared
+// path for both ServiceStart and ServiceStartBatch.
+func (se *ServiceEndpoint) startOne(sr serviceRequest) (service.ID, *service.Instance, error) {
+	if se.isAlreadyRunning(sr) {
+		return "", nil, errServiceAlreadyRunning
+	}
+
+	id, err := se.serviceManager.Start(identity.FromAddress(sr.ProviderID), sr.ServiceType, sr.Options, sr.SecurityContext)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if sr.Autostart {
+		se.persistAutostart(id, sr)
+	}
+
+	return id, se.serviceManager.Service(id), nil
+}
+
+// stopAndUnpersist stops id and, if it was persisted for autostart, prunes that entry too - used
+// to roll back an atomically-aborted batch start as a unit, so a service the batch undid doesn't
+// come back on the next node boot via Manager.Restore.
+func (se *ServiceEndpoint) stopAndUnpersist(id service.ID) error {
+	err := se.serviceManager.Stop(id)
+	if se.autostart != nil {
+		_ = se.autostart.Delete(id)
+	}
+	return err
+}
+
+// persistAutostart saves a successfully started service so serviceManager.Restore can bring it
+// back up again on the next node boot. Persistence failures are ignored and don't fail the
+// request - the service is already running either way.
+func (se *ServiceEndpoint) persistAutostart(id service.ID, sr serviceRequest) {
+	if se.autostart == nil {
+		return
+	}
+
+	options, err := json.Marshal(sr.Options)
+	if err != nil {
+		return
+	}
+
+	_ = se.autostart.Save(service.AutostartEntry{
+		ServiceID:       id,
+		ProviderID:      identity.FromAddress(sr.ProviderID),
+		ServiceType:     sr.ServiceType,
+		Options:         options,
+		SecurityContext: sr.SecurityContext,
+		Added:           time.Now().UTC(),
+	})
+}
+
 // ServiceStop stops service on the node.
 // swagger:operation DELETE /services/:id Service serviceStop
 // ---
 // summary: Stops service
 // description: Initiates service stop
+// parameters:
+//   - in: query
+//     name: autostart
+//     type: boolean
+//     required: false
+//     description: pass "false" to also prune this service's persisted autostart entry
 // responses:
 //   202:
 //     description: Service Stop initiated
@@ -217,11 +544,11 @@ func (se *ServiceEndpoint) ServiceStart(resp http.ResponseWriter, req *http.Requ
 //     description: Internal server error
 //     schema:
 //       "$ref": "#/definitions/ErrorMessageDTO"
-func (se *ServiceEndpoint) ServiceStop(resp http.ResponseWriter, _ *http.Request, params httprouter.Params) {
+func (se *ServiceEndpoint) ServiceStop(resp http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	id := service.ID(params.ByName("id"))
-	service := se.serviceManager.Service(id)
+	instance := se.serviceManager.Service(id)
 
-	if service == nil {
+	if instance == nil {
 		utils.SendErrorMessage(resp, "Service not found", http.StatusNotFound)
 		return
 	}
@@ -230,6 +557,111 @@ func (se *ServiceEndpoint) ServiceStop(resp http.ResponseWriter, _ *http.Request
 		utils.SendError(resp, err, http.StatusInternalServerError)
 		return
 	}
+
+	if req.URL.Query().Get("autostart") == "false" && se.autostart != nil {
+		_ = se.autostart.Delete(id)
+	}
+
+	resp.WriteHeader(http.StatusAccepted)
+}
+
+// ServiceAutostartList lists the services that have been persisted for automatic restart on
+// node boot, so operators can inspect and prune the set without editing the store directly.
+// swagger:operation GET /services/autostart Service serviceAutostartList
+// ---
+// summary: Lists autostart services
+// description: ServiceAutostartList lists services persisted for automatic restart on node boot
+// responses:
+//   200:
+//     description: Persisted autostart entries
+//     schema:
+//       type: array
+//       items:
+//         "$ref": "#/definitions/ServiceAutostartEntryDTO"
+//   500:
+//     description: Internal server error
+//     schema:
+//       "$ref": "#/definitions/ErrorMessageDTO"
+func (se *ServiceEndpoint) ServiceAutostartList(resp http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	if se.autostart == nil {
+		utils.WriteAsJSON(make([]serviceAutostartEntry, 0), resp)
+		return
+	}
+
+	entries, err := se.autostart.All()
+	if err != nil {
+		utils.SendError(resp, err, http.StatusInternalServerError)
+		return
+	}
+
+	res := make([]serviceAutostartEntry, len(entries))
+	for i, entry := range entries {
+		res[i] = serviceAutostartEntry{
+			ID:          string(entry.ServiceID),
+			ProviderID:  entry.ProviderID.Address,
+			ServiceType: entry.ServiceType,
+		}
+	}
+	utils.WriteAsJSON(res, resp)
+}
+
+// swagger:model ServiceReconnectRequestDTO
+type serviceReconnectRequest struct {
+	// delay, in seconds, before the transport is re-established
+	// required: false
+	AfterSeconds int `json:"afterSeconds"`
+}
+
+// ServiceReconnect restarts the underlying transport of a running service - for every service
+// type but "noop" that is a rebind of its UDP socket on the same port - while keeping the
+// service.ID and its proposal registration intact. WireGuard peers and OpenVPN listeners are not
+// refreshed. It is the provider-side
+// counterpart of the mobile consumer's sessionTracker.Reconnect.
+// swagger:operation POST /services/:id/reconnect Service serviceReconnect
+// ---
+// summary: Reconnects service
+// description: Re-establishes the service transport after an ISP/IP change without stopping sessions or re-publishing the proposal
+// parameters:
+//   - in: body
+//     name: body
+//     description: Optional delay before reconnecting
+//     schema:
+//       $ref: "#/definitions/ServiceReconnectRequestDTO"
+// responses:
+//   202:
+//     description: Reconnect initiated
+//   404:
+//     description: Service not found
+//     schema:
+//       "$ref": "#/definitions/ErrorMessageDTO"
+//   500:
+//     description: Internal server error
+//     schema:
+//       "$ref": "#/definitions/ErrorMessageDTO"
+func (se *ServiceEndpoint) ServiceReconnect(resp http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	id := service.ID(params.ByName("id"))
+	if se.serviceManager.Service(id) == nil {
+		utils.SendErrorMessage(resp, "Service not found", http.StatusNotFound)
+		return
+	}
+
+	var rr serviceReconnectRequest
+	if req.ContentLength > 0 {
+		if err := json.NewDecoder(req.Body).Decode(&rr); err != nil {
+			utils.SendError(resp, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Reconnect blocks for rr.AfterSeconds before rebinding the transport, so it's run in the
+	// background - otherwise a caller-requested delay would hold this goroutine (and the client)
+	// hostage instead of getting the documented 202 straight away.
+	go func() {
+		if err := se.serviceManager.Reconnect(id, rr.AfterSeconds); err != nil {
+			log.Error().Err(err).Msgf("service reconnect failed for %s", id)
+		}
+	}()
+
 	resp.WriteHeader(http.StatusAccepted)
 }
 
@@ -244,20 +676,26 @@ func (se *ServiceEndpoint) isAlreadyRunning(sr serviceRequest) bool {
 }
 
 // AddRoutesForService adds service routes to given router
-func AddRoutesForService(router *httprouter.Router, serviceManager ServiceManager, optionsParser map[string]ServiceOptionsParser) {
-	serviceEndpoint := NewServiceEndpoint(serviceManager, optionsParser)
+func AddRoutesForService(router *httprouter.Router, serviceManager ServiceManager, optionsParser map[string]ServiceOptionsParser, eventBus eventbus.EventBus, autostart service.AutostartStorage) {
+	serviceEndpoint := NewServiceEndpoint(serviceManager, optionsParser, eventBus, autostart)
 
 	router.GET("/services", serviceEndpoint.ServiceList)
+	router.GET("/services/events", serviceEndpoint.ServiceEvents)
+	router.GET("/services/autostart", serviceEndpoint.ServiceAutostartList)
 	router.POST("/services", serviceEndpoint.ServiceStart)
+	router.POST("/services/batch", serviceEndpoint.ServiceStartBatch)
 	router.GET("/services/:id", serviceEndpoint.ServiceGet)
 	router.DELETE("/services/:id", serviceEndpoint.ServiceStop)
+	router.POST("/services/:id/reconnect", serviceEndpoint.ServiceReconnect)
 }
 
 func (se *ServiceEndpoint) toServiceRequest(req *http.Request) (sr serviceRequest, err error) {
 	var jsonData struct {
-		ProviderID  string           `json:"providerId"`
-		ServiceType string           `json:"serviceType"`
-		Options     *json.RawMessage `json:"options"`
+		ProviderID      string                   `json:"providerId"`
+		ServiceType     string                   `json:"serviceType"`
+		Options         *json.RawMessage         `json:"options"`
+		SecurityContext *service.SecurityContext `json:"securityContext"`
+		Autostart       bool                     `json:"autostart"`
 	}
 	if err = json.NewDecoder(req.Body).Decode(&jsonData); err != nil {
 		return
@@ -265,6 +703,8 @@ func (se *ServiceEndpoint) toServiceRequest(req *http.Request) (sr serviceReques
 
 	sr.ProviderID = jsonData.ProviderID
 	sr.ServiceType = jsonData.ServiceType
+	sr.SecurityContext = jsonData.SecurityContext
+	sr.Autostart = jsonData.Autostart
 
 	if jsonData.Options != nil {
 		optionsParser, ok := se.optionsParser[sr.ServiceType]
@@ -312,9 +752,15 @@ func validateServiceRequest(sr serviceRequest) *validation.FieldErrorMap {
 
 // ServiceManager represents service manager that will be used for manipulation node services.
 type ServiceManager interface {
-	Start(providerID identity.Identity, serviceType string, options service.Options) (service.ID, error)
+	Start(providerID identity.Identity, serviceType string, options service.Options, securityContext *service.SecurityContext) (service.ID, error)
 	Stop(id service.ID) error
 	Service(id service.ID) *service.Instance
 	Kill() error
 	List() map[service.ID]*service.Instance
+	// Reconnect restarts the underlying transport of a running service without tearing down
+	// its sessions or proposal registration.
+	Reconnect(id service.ID, afterSeconds int) error
 }
+
+// compile-time assertion that service.Manager keeps satisfying ServiceManager as both evolve
+var _ ServiceManager = (*service.Manager)(nil)
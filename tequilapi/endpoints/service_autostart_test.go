@@ -0,0 +1,66 @@
+/*
+ * Copyright (C) 2020 The "MysteriumNetwork/node" Authors.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mysteriumnetwork/node/core/service"
+	"github.com/mysteriumnetwork/node/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceAutostartListReturnsPersistedEntries(t *testing.T) {
+	autostart := newFakeAutostartStorage()
+	require.NoError(t, autostart.Save(service.AutostartEntry{
+		ServiceID:   "noop-1",
+		ProviderID:  identity.Identity{Address: "0xaa"},
+		ServiceType: "noop",
+	}))
+
+	endpoint := NewServiceEndpoint(newFakeServiceManager(t), nil, nil, autostart)
+
+	resp := httptest.NewRecorder()
+	endpoint.ServiceAutostartList(resp, httptest.NewRequest(http.MethodGet, "/services/autostart", nil), nil)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var entries []serviceAutostartEntry
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, "noop-1", entries[0].ID)
+	assert.Equal(t, "0xaa", entries[0].ProviderID)
+	assert.Equal(t, "noop", entries[0].ServiceType)
+}
+
+func TestServiceAutostartListEmptyWhenNoStore(t *testing.T) {
+	endpoint := NewServiceEndpoint(newFakeServiceManager(t), nil, nil, nil)
+
+	resp := httptest.NewRecorder()
+	endpoint.ServiceAutostartList(resp, httptest.NewRequest(http.MethodGet, "/services/autostart", nil), nil)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var entries []serviceAutostartEntry
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &entries))
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2020 The "MysteriumNetwork/node" Authors.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceStartBatchAtomicAbortRollsBackAndReportsStoppedStatus(t *testing.T) {
+	manager := newFakeServiceManager(t)
+	manager.failStartFor("0xbb", errFakeStart)
+
+	endpoint := NewServiceEndpoint(manager, nil, nil, nil)
+
+	body := requireBatchRequestBody(t, serviceBatchRequest{
+		Atomic:   true,
+		Services: []serviceRequest{noopServiceRequest("0xaa"), noopServiceRequest("0xbb")},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/services/batch", bytes.NewReader(body))
+	resp := httptest.NewRecorder()
+
+	endpoint.ServiceStartBatch(resp, req, nil)
+
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+
+	var results []serviceStartResult
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &results))
+	require.Len(t, results, 2)
+
+	require.NotNil(t, results[0].Service)
+	assert.Equal(t, "NotRunning", results[0].Service.Status)
+	assert.NotEmpty(t, results[0].Error)
+
+	assert.Nil(t, results[1].Service)
+	assert.Equal(t, errFakeStart.Error(), results[1].Error)
+
+	assert.Empty(t, manager.List())
+}
+
+func TestServiceStartBatchNonAtomicKeepsSuccessesAndReportsFailures(t *testing.T) {
+	manager := newFakeServiceManager(t)
+	manager.failStartFor("0xbb", errFakeStart)
+
+	endpoint := NewServiceEndpoint(manager, nil, nil, nil)
+
+	body := requireBatchRequestBody(t, serviceBatchRequest{
+		Atomic:   false,
+		Services: []serviceRequest{noopServiceRequest("0xaa"), noopServiceRequest("0xbb"), noopServiceRequest("0xcc")},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/services/batch", bytes.NewReader(body))
+	resp := httptest.NewRecorder()
+
+	endpoint.ServiceStartBatch(resp, req, nil)
+
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	var results []serviceStartResult
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &results))
+	require.Len(t, results, 3)
+
+	assert.NotNil(t, results[0].Service)
+	assert.Nil(t, results[1].Service)
+	assert.Equal(t, errFakeStart.Error(), results[1].Error)
+	assert.NotNil(t, results[2].Service)
+
+	assert.Len(t, manager.List(), 2)
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright (C) 2020 The "MysteriumNetwork/node" Authors.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package endpoints
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mysteriumnetwork/node/core/service"
+	"github.com/mysteriumnetwork/node/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flushRecorder wraps httptest.NewRecorder's *http.ResponseRecorder (which already implements
+// http.Flusher) so the test can observe every Flush via a channel instead of polling the buffer.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushed chan struct{}
+}
+
+func newFlushRecorder() *flushRecorder {
+	return &flushRecorder{ResponseRecorder: httptest.NewRecorder(), flushed: make(chan struct{}, 16)}
+}
+
+func (r *flushRecorder) Flush() {
+	r.ResponseRecorder.Flush()
+	select {
+	case r.flushed <- struct{}{}:
+	default:
+	}
+}
+
+func waitForFlush(t *testing.T, resp *flushRecorder) {
+	t.Helper()
+	select {
+	case <-resp.flushed:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for ServiceEvents to flush a write")
+	}
+}
+
+func TestServiceEventsStreamsMatchingStateChangeAndSkipsOthers(t *testing.T) {
+	manager := newFakeServiceManager(t)
+	id, err := manager.Start(identity.Identity{Address: "0xaa"}, "noop", nil, nil)
+	require.NoError(t, err)
+	other, err := manager.Start(identity.Identity{Address: "0xbb"}, "noop", nil, nil)
+	require.NoError(t, err)
+
+	bus := newFakeEventBus()
+	bus.subscribed = make(chan string, 1)
+	endpoint := NewServiceEndpoint(manager, nil, bus, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodGet, "/services/events?id="+string(id), nil).WithContext(ctx)
+	resp := newFlushRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		endpoint.ServiceEvents(resp, req, nil)
+		close(done)
+	}()
+
+	select {
+	case <-bus.subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("ServiceEvents did not subscribe to service.StatusTopic in time")
+	}
+
+	// Event for a different service id - should be filtered out, not appear in the body.
+	bus.Publish(service.StatusTopic, service.StateEvent{ID: other})
+
+	// Event for the subscribed id - should show up as a state-change.
+	bus.Publish(service.StatusTopic, service.StateEvent{ID: id})
+	waitForFlush(t, resp)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("ServiceEvents did not return after its context was cancelled")
+	}
+
+	bodyStr := resp.Body.String()
+	assert.Contains(t, bodyStr, `"event":"state-change"`)
+	assert.Contains(t, bodyStr, string(id))
+	assert.NotContains(t, bodyStr, string(other))
+}
@@ -0,0 +1,200 @@
+/*
+ * Copyright (C) 2020 The "MysteriumNetwork/node" Authors.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package endpoints
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/mysteriumnetwork/node/core/service"
+	"github.com/mysteriumnetwork/node/identity"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServiceManager wraps a real *service.Manager so tests get genuine Instance values (state,
+// proposal) out of Service/List without reaching into service's unexported fields, while letting
+// individual tests make Start/Reconnect fail or block on demand.
+type fakeServiceManager struct {
+	*service.Manager
+
+	mu             sync.Mutex
+	failStart      map[string]error
+	reconnectGate  chan struct{}
+	reconnectCalls []service.ID
+}
+
+func newFakeServiceManager(t *testing.T) *fakeServiceManager {
+	m, err := service.NewManager(nil, nil, nil, 0, 0)
+	require.NoError(t, err)
+	return &fakeServiceManager{Manager: m, failStart: make(map[string]error)}
+}
+
+// failStartFor makes Start return err every time it's called for providerID, instead of
+// delegating to the wrapped Manager.
+func (f *fakeServiceManager) failStartFor(providerID string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failStart[providerID] = err
+}
+
+func (f *fakeServiceManager) Start(providerID identity.Identity, serviceType string, options service.Options, securityContext *service.SecurityContext) (service.ID, error) {
+	f.mu.Lock()
+	err, shouldFail := f.failStart[providerID.Address]
+	f.mu.Unlock()
+
+	if shouldFail {
+		return "", err
+	}
+	return f.Manager.Start(providerID, serviceType, options, securityContext)
+}
+
+// blockReconnectOn makes Reconnect wait for gate to be closed before it delegates to the wrapped
+// Manager, so a test can assert the HTTP handler responded before Reconnect actually ran.
+func (f *fakeServiceManager) blockReconnectOn(gate chan struct{}) {
+	f.reconnectGate = gate
+}
+
+func (f *fakeServiceManager) Reconnect(id service.ID, afterSeconds int) error {
+	if f.reconnectGate != nil {
+		<-f.reconnectGate
+	}
+
+	f.mu.Lock()
+	f.reconnectCalls = append(f.reconnectCalls, id)
+	f.mu.Unlock()
+
+	return f.Manager.Reconnect(id, afterSeconds)
+}
+
+var errFakeStart = errors.New("fake start failure")
+
+// fakeAutostartStorage is an in-memory service.AutostartStorage.
+type fakeAutostartStorage struct {
+	mu      sync.Mutex
+	entries map[service.ID]service.AutostartEntry
+}
+
+func newFakeAutostartStorage() *fakeAutostartStorage {
+	return &fakeAutostartStorage{entries: make(map[service.ID]service.AutostartEntry)}
+}
+
+func (s *fakeAutostartStorage) Save(entry service.AutostartEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[entry.ServiceID] = entry
+	return nil
+}
+
+func (s *fakeAutostartStorage) Delete(id service.ID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, id)
+	return nil
+}
+
+func (s *fakeAutostartStorage) All() ([]service.AutostartEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]service.AutostartEntry, 0, len(s.entries))
+	for _, e := range s.entries {
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+// fakeEventBus is a minimal in-process implementation of eventbus.EventBus, sufficient for
+// ServiceEvents to subscribe, receive a published service.StateEvent and unsubscribe again.
+type fakeEventBus struct {
+	mu       sync.Mutex
+	handlers map[string][]func(service.StateEvent)
+
+	// subscribed, when set, receives the topic every time SubscribeAsync registers a handler - so
+	// a test can wait for a subscriber to be ready before Publish-ing, instead of racing it.
+	subscribed chan string
+}
+
+func newFakeEventBus() *fakeEventBus {
+	return &fakeEventBus{handlers: make(map[string][]func(service.StateEvent))}
+}
+
+func (b *fakeEventBus) Publish(topic string, data interface{}) {
+	event, ok := data.(service.StateEvent)
+	if !ok {
+		return
+	}
+
+	b.mu.Lock()
+	handlers := append([]func(service.StateEvent){}, b.handlers[topic]...)
+	b.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+func (b *fakeEventBus) Subscribe(topic string, fn interface{}) error {
+	return b.SubscribeAsync(topic, fn)
+}
+
+func (b *fakeEventBus) SubscribeAsync(topic string, fn interface{}) error {
+	handler, ok := fn.(func(service.StateEvent))
+	if !ok {
+		return errors.New("fakeEventBus only supports func(service.StateEvent) handlers")
+	}
+
+	b.mu.Lock()
+	b.handlers[topic] = append(b.handlers[topic], handler)
+	subscribed := b.subscribed
+	b.mu.Unlock()
+
+	if subscribed != nil {
+		subscribed <- topic
+	}
+	return nil
+}
+
+func (b *fakeEventBus) SubscribeWithUID(topic string, _ string, fn interface{}) error {
+	return b.SubscribeAsync(topic, fn)
+}
+
+// Unsubscribe drops every handler registered for topic. The tests only ever register one handler
+// per topic at a time, so this is equivalent to removing the specific fn without needing handler
+// identity comparison.
+func (b *fakeEventBus) Unsubscribe(topic string, _ interface{}) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.handlers, topic)
+	return nil
+}
+
+func (b *fakeEventBus) UnsubscribeByUID(_ string, _ string) error {
+	return nil
+}
+
+func noopServiceRequest(providerID string) serviceRequest {
+	return serviceRequest{ProviderID: providerID, ServiceType: "noop"}
+}
+
+func requireBatchRequestBody(t *testing.T, br serviceBatchRequest) []byte {
+	data, err := json.Marshal(br)
+	require.NoError(t, err)
+	return data
+}
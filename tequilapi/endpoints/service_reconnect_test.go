@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2020 The "MysteriumNetwork/node" Authors.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/mysteriumnetwork/node/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceReconnectNotFound(t *testing.T) {
+	manager := newFakeServiceManager(t)
+	endpoint := NewServiceEndpoint(manager, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/services/unknown/reconnect", nil)
+	resp := httptest.NewRecorder()
+
+	endpoint.ServiceReconnect(resp, req, httprouter.Params{{Key: "id", Value: "unknown"}})
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestServiceReconnectRespondsBeforeDelayElapses(t *testing.T) {
+	manager := newFakeServiceManager(t)
+	id, err := manager.Start(identity.Identity{Address: "0xaa"}, "noop", nil, nil)
+	require.NoError(t, err)
+
+	gate := make(chan struct{})
+	manager.blockReconnectOn(gate)
+	endpoint := NewServiceEndpoint(manager, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/services/"+string(id)+"/reconnect", nil)
+	resp := httptest.NewRecorder()
+
+	endpoint.ServiceReconnect(resp, req, httprouter.Params{{Key: "id", Value: string(id)}})
+
+	// The handler must have returned 202 already, even though Reconnect is still blocked on gate.
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+
+	time.Sleep(50 * time.Millisecond)
+	manager.mu.Lock()
+	calls := len(manager.reconnectCalls)
+	manager.mu.Unlock()
+	assert.Equal(t, 0, calls, "Reconnect should not have run yet")
+
+	close(gate)
+
+	require.Eventually(t, func() bool {
+		manager.mu.Lock()
+		defer manager.mu.Unlock()
+		return len(manager.reconnectCalls) == 1
+	}, time.Second, 10*time.Millisecond)
+}